@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	indexFlag   = "index"
+	zfsDiffFlag = "zfs-diff"
+)
+
+// runIndexCmd implements `gofseek index --path P`: it walks path and writes
+// a fresh on-disk index, replacing whatever was at --index (or the default
+// ~/.cache/gofseek/index) atomically.
+func runIndexCmd(args []string) error {
+	flagset := flag.NewFlagSet("index", flag.ExitOnError)
+	flagset.StringP(pathFlag, "p", "", "Defines the target path to index")
+	flagset.String(indexFlag, "", "Defines the index file to write (default ~/.cache/gofseek/index)")
+	flagset.Int64(concurrencyFlag, defaultConcurrency(), "Defines the number of directories that may be read concurrently")
+	addFilterFlags(flagset)
+	flagset.Parse(args)
+
+	path, err := flagset.GetString(pathFlag)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("argument `--%s` to build the index required", pathFlag)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	indexPath, err := indexFlagValue(flagset)
+	if err != nil {
+		return err
+	}
+
+	concurrency, err := flagset.GetInt64(concurrencyFlag)
+	if err != nil {
+		return err
+	}
+
+	filters, err := filtersFromFlags(flagset, path)
+	if err != nil {
+		return err
+	}
+
+	groups := make(chan DirGroup)
+	sem := semaphore.NewWeighted(concurrency)
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		return indexWalk(ctx, g, sem, path, filters, groups)
+	})
+
+	go func() {
+		if err := g.Wait(); err != nil {
+			log.Printf("Error indexing path %s: %v", path, err)
+		}
+		close(groups)
+	}()
+
+	if err := writeIndexAtomically(indexPath, groups); err != nil {
+		return err
+	}
+
+	return g.Wait()
+}
+
+// runQueryCmd implements `gofseek query --limit N`: it answers purely from
+// the on-disk index, without touching the filesystem at all.
+func runQueryCmd(args []string) error {
+	flagset := flag.NewFlagSet("query", flag.ExitOnError)
+	flagset.IntP(limitFlag, "l", 100, "Defines the limit of top biggest files to print out")
+	flagset.String(indexFlag, "", "Defines the index file to query (default ~/.cache/gofseek/index)")
+	flagset.Parse(args)
+
+	limit, err := flagset.GetInt(limitFlag)
+	if err != nil {
+		return err
+	}
+
+	indexPath, err := indexFlagValue(flagset)
+	if err != nil {
+		return err
+	}
+
+	files := make(chan FileDiskUsage)
+	readErrs := make(chan error, 1)
+
+	go func() {
+		defer close(files)
+		readErrs <- readIndex(indexPath, func(group DirGroup) error {
+			for _, e := range group.Entries {
+				files <- FileDiskUsage{Path: e.Path, Size: e.Size}
+			}
+			return nil
+		})
+	}()
+
+	top := topNFiles(files, limit)
+	if err := <-readErrs; err != nil {
+		return err
+	}
+
+	printTable(tw, top)
+
+	return nil
+}
+
+// runUpdateCmd implements `gofseek update --path P`: it rescans only the
+// directories under path whose mtime changed since the last index, or, if
+// --zfs-diff is set, applies a `zfs diff` stream to the index directly and
+// skips the walk entirely.
+func runUpdateCmd(args []string) error {
+	flagset := flag.NewFlagSet("update", flag.ExitOnError)
+	flagset.StringP(pathFlag, "p", "", "Defines the target path to rescan")
+	flagset.String(indexFlag, "", "Defines the index file to update (default ~/.cache/gofseek/index)")
+	flagset.String(zfsDiffFlag, "", "Applies a `zfs diff` stream to the index instead of walking the filesystem")
+	flagset.Int64(concurrencyFlag, defaultConcurrency(), "Defines the number of directories that may be read concurrently")
+	addFilterFlags(flagset)
+	flagset.Parse(args)
+
+	indexPath, err := indexFlagValue(flagset)
+	if err != nil {
+		return err
+	}
+
+	zfsDiffFile, err := flagset.GetString(zfsDiffFlag)
+	if err != nil {
+		return err
+	}
+
+	if zfsDiffFile != "" {
+		return applyZFSDiff(indexPath, zfsDiffFile)
+	}
+
+	path, err := flagset.GetString(pathFlag)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("argument `--%s` required unless `--%s` is set", pathFlag, zfsDiffFlag)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	concurrency, err := flagset.GetInt64(concurrencyFlag)
+	if err != nil {
+		return err
+	}
+
+	filters, err := filtersFromFlags(flagset, path)
+	if err != nil {
+		return err
+	}
+
+	known, err := dirMtimes(indexPath)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]DirGroup, len(known))
+	children := make(map[string][]string, len(known))
+	if err := readIndex(indexPath, func(group DirGroup) error {
+		existing[group.Dir] = group
+		children[filepath.Dir(group.Dir)] = append(children[filepath.Dir(group.Dir)], group.Dir)
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	groups := make(chan DirGroup)
+	sem := semaphore.NewWeighted(concurrency)
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		return rescanChanged(ctx, g, sem, path, filters, known, existing, children, groups)
+	})
+
+	go func() {
+		err := g.Wait()
+		if err != nil {
+			log.Printf("Error updating path %s: %v", path, err)
+		} else {
+			// path's own subtree was just fully accounted for above, whether
+			// a directory in it was forwarded, refreshed, or is now simply
+			// gone; anything the index knew about OUTSIDE that subtree (a
+			// different root entirely) is carried forward untouched instead
+			// of being dropped.
+			for dir, group := range existing {
+				if !isUnderRoot(dir, path) {
+					groups <- group
+				}
+			}
+		}
+		close(groups)
+	}()
+
+	if err := writeIndexAtomically(indexPath, groups); err != nil {
+		return err
+	}
+
+	return g.Wait()
+}
+
+// isUnderRoot reports whether dir is root itself or a descendant of it.
+// Both are expected to already be filepath.Clean'd absolute paths; root is
+// handled specially when it's already "/" so it doesn't turn into the
+// unmatchable prefix "//".
+func isUnderRoot(dir, root string) bool {
+	if dir == root {
+		return true
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	return strings.HasPrefix(dir, prefix)
+}
+
+func indexFlagValue(flagset *flag.FlagSet) (string, error) {
+	value, err := flagset.GetString(indexFlag)
+	if err != nil {
+		return "", err
+	}
+	if value != "" {
+		return value, nil
+	}
+
+	return defaultIndexPath()
+}
+
+// topNFiles drains in and returns its n largest files, sorted descending.
+func topNFiles(in <-chan FileDiskUsage, n int) []FileDiskUsage {
+	cap := n + 1
+	buf := make([]FileDiskUsage, 0, cap)
+
+	for f := range in {
+		buf = append(buf, f)
+		if len(buf) < cap {
+			continue
+		}
+
+		sortBySizeDesc(buf)
+		buf = buf[:n]
+	}
+
+	sortBySizeDesc(buf)
+	if len(buf) > n {
+		buf = buf[:n]
+	}
+
+	return buf
+}
+
+// rescanChanged re-walks dir only if its mtime no longer matches what's
+// recorded in known; otherwise it forwards the directory's stored group
+// with its entries re-statted (see forwardSubtree) instead of re-reading
+// the directory, and checks each of its known child directories the same
+// way.
+func rescanChanged(ctx context.Context, g *errgroup.Group, sem *semaphore.Weighted, dir string, filters Filters, known map[string]time.Time, existing map[string]DirGroup, children map[string][]string, groups chan<- DirGroup) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if prev, ok := known[dir]; ok && prev.Equal(info.ModTime()) {
+		return forwardSubtree(ctx, g, sem, dir, filters, known, existing, children, groups)
+	}
+
+	group := DirGroup{Dir: dir, Mtime: info.ModTime()}
+
+	visitFile := func(childPath string, fileinfo os.FileInfo) error {
+		group.Entries = append(group.Entries, IndexEntry{
+			Path:  childPath,
+			Size:  fileinfo.Size(),
+			Mtime: fileinfo.ModTime(),
+			Inode: inodeOf(fileinfo),
+		})
+		return nil
+	}
+
+	recurseDir := func(childPath string) error {
+		return rescanChanged(ctx, g, sem, childPath, filters, known, existing, children, groups)
+	}
+
+	if err := walkTree(ctx, g, sem, dir, filters, visitFile, recurseDir); err != nil {
+		return err
+	}
+
+	select {
+	case groups <- group:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// forwardSubtree forwards dir's cached group when dir's own mtime hasn't
+// changed, and hands each of dir's known children back to rescanChanged,
+// so a child whose own mtime changed is re-walked. A matching
+// directory mtime only rules out entries being added, removed, or renamed;
+// editing a file's content in place changes that file's own mtime but not
+// its parent directory's, so every recorded entry is still re-statted and
+// refreshed before being forwarded.
+func forwardSubtree(ctx context.Context, g *errgroup.Group, sem *semaphore.Weighted, dir string, filters Filters, known map[string]time.Time, existing map[string]DirGroup, children map[string][]string, groups chan<- DirGroup) error {
+	if group, ok := existing[dir]; ok {
+		refreshed, err := refreshEntries(group, filters)
+		if err != nil {
+			return err
+		}
+		groups <- refreshed
+	}
+
+	for _, child := range children[dir] {
+		if err := rescanChanged(ctx, g, sem, child, filters, known, existing, children, groups); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshEntries re-stats every entry recorded in group and updates its
+// size, mtime and inode if they drifted, without re-reading the directory
+// itself. It's used when the directory's own mtime matched the cache, so
+// the set of entries is known to be unchanged, but an in-place edit to one
+// of them would otherwise go unnoticed forever.
+func refreshEntries(group DirGroup, filters Filters) (DirGroup, error) {
+	refreshed := make([]IndexEntry, 0, len(group.Entries))
+
+	for _, e := range group.Entries {
+		fileinfo, err := filters.StatFile(e.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return DirGroup{}, err
+		}
+
+		refreshed = append(refreshed, IndexEntry{
+			Path:  e.Path,
+			Size:  fileinfo.Size(),
+			Mtime: fileinfo.ModTime(),
+			Inode: inodeOf(fileinfo),
+		})
+	}
+
+	group.Entries = refreshed
+	return group, nil
+}
+
+func writeIndexAtomically(path string, groups <-chan DirGroup) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if err := writeIndex(tmp, groups); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// applyZFSDiff reads a `zfs diff` stream from diffFile and applies its
+// `+`/`-`/`M`/`R` events directly to the index at indexPath, avoiding a full
+// walk of the backing store when it's a ZFS dataset.
+func applyZFSDiff(indexPath, diffFile string) error {
+	groups := make(map[string]*DirGroup)
+	if err := readIndex(indexPath, func(group DirGroup) error {
+		g := group
+		groups[g.Dir] = &g
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(diffFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := applyZFSDiffLine(groups, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	out := make(chan DirGroup)
+	go func() {
+		defer close(out)
+		for _, group := range groups {
+			out <- *group
+		}
+	}()
+
+	return writeIndexAtomically(indexPath, out)
+}
+
+func applyZFSDiffLine(groups map[string]*DirGroup, line string) error {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 2 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "-":
+		removeIndexEntry(groups, fields[1])
+		return nil
+	case "R":
+		if len(fields) < 3 {
+			return fmt.Errorf("malformed zfs diff rename line: %q", line)
+		}
+		removeIndexEntry(groups, fields[1])
+		return upsertIndexEntry(groups, fields[2])
+	default: // "+" and "M" both resolve to a fresh stat of the current path
+		return upsertIndexEntry(groups, fields[1])
+	}
+}
+
+func removeIndexEntry(groups map[string]*DirGroup, path string) {
+	group, ok := groups[filepath.Dir(path)]
+	if !ok {
+		return
+	}
+
+	for i, e := range group.Entries {
+		if e.Path == path {
+			group.Entries = append(group.Entries[:i], group.Entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func upsertIndexEntry(groups map[string]*DirGroup, path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		removeIndexEntry(groups, path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	group, ok := groups[dir]
+	if !ok {
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		group = &DirGroup{Dir: dir, Mtime: dirInfo.ModTime()}
+		groups[dir] = group
+	}
+
+	entry := IndexEntry{Path: path, Size: info.Size(), Mtime: info.ModTime(), Inode: inodeOf(info)}
+	for i, e := range group.Entries {
+		if e.Path == path {
+			group.Entries[i] = entry
+			return nil
+		}
+	}
+
+	group.Entries = append(group.Entries, entry)
+	return nil
+}
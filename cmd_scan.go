@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	groupByFlag = "group-by"
+	groupByRoot = "root"
+	groupByNone = "none"
+)
+
+// scanRoots resolves the walk roots for the default (no subcommand)
+// invocation: every --path plus, like the classic `du` CLI, any positional
+// arguments. Roots are resolved to absolute paths so --exclude patterns
+// (matched against each entry's absolute path) behave the same regardless
+// of the current working directory or how --path was spelled.
+func scanRoots(flags *flag.FlagSet) ([]string, error) {
+	roots, err := flags.GetStringArray(pathFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	roots = append(roots, flags.Args()...)
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("at least one `--%s` or a positional path is required", pathFlag)
+	}
+
+	for i, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = abs
+	}
+
+	return roots, nil
+}
+
+// runScan walks every root concurrently under one shared semaphore and a
+// shared top-level errgroup, so an error under any root cancels all of
+// them. Results are reported per --group-by: "root" prints a table per
+// root plus a merged table, "none" prints a single global table.
+func runScan(args []string) error {
+	flags := initFlags(os.Args[0], args)
+
+	roots, err := scanRoots(flags)
+	if err != nil {
+		return err
+	}
+
+	limit, err := flags.GetInt(limitFlag)
+	if err != nil {
+		return err
+	}
+
+	live, err := flags.GetBool(liveFlag)
+	if err != nil {
+		return err
+	}
+
+	noConsole, err := flags.GetBool(noConsoleFlag)
+	if err != nil {
+		return err
+	}
+	if noConsole {
+		live = false
+	}
+
+	concurrency, err := flags.GetInt64(concurrencyFlag)
+	if err != nil {
+		return err
+	}
+
+	groupBy, err := flags.GetString(groupByFlag)
+	if err != nil {
+		return err
+	}
+	if groupBy != groupByRoot && groupBy != groupByNone {
+		return fmt.Errorf("argument `--%s` must be %q or %q", groupByFlag, groupByRoot, groupByNone)
+	}
+
+	log.Printf("Seeking top %d biggest files across %d root(s)", limit, len(roots))
+
+	sem := semaphore.NewWeighted(concurrency)
+	topG, topCtx := errgroup.WithContext(context.Background())
+
+	global := make(chan FileDiskUsage)
+	perRoot := make(map[string]chan FileDiskUsage, len(roots))
+	if groupBy == groupByRoot {
+		for _, root := range roots {
+			perRoot[root] = make(chan FileDiskUsage)
+		}
+	}
+
+	var teeWG sync.WaitGroup
+	for _, root := range roots {
+		root := root
+		filters, err := filtersFromFlags(flags, root)
+		if err != nil {
+			return err
+		}
+
+		diskUsage := make(chan FileDiskUsage)
+
+		topG.Go(func() error {
+			rootG, rootCtx := errgroup.WithContext(topCtx)
+			rootG.Go(func() error {
+				log.Printf("Starting with path: %s", root)
+				return walkDir(rootCtx, rootG, sem, root, filters, diskUsage)
+			})
+			err := rootG.Wait()
+			close(diskUsage)
+			return err
+		})
+
+		teeWG.Add(1)
+		go func() {
+			defer teeWG.Done()
+			out := perRoot[root]
+			for file := range diskUsage {
+				global <- file
+				if out != nil {
+					out <- file
+				}
+			}
+		}()
+	}
+
+	go func() {
+		teeWG.Wait()
+		close(global)
+		for _, out := range perRoot {
+			close(out)
+		}
+	}()
+
+	// The global/merged table is the only one that gets to redraw live:
+	// redrawing several tables in place at once would just interleave
+	// garbage on the same terminal, so per-root tables always collect
+	// quietly and print once, after every walk has finished.
+	var collectWG sync.WaitGroup
+	rootResults := make(map[string][]FileDiskUsage, len(perRoot))
+	var rootResultsMu sync.Mutex
+
+	for _, root := range roots {
+		out, ok := perRoot[root]
+		if !ok {
+			continue
+		}
+
+		root, out := root, out
+		collectWG.Add(1)
+		go func() {
+			defer collectWG.Done()
+			last := collectGroup(out, limit, false)
+			rootResultsMu.Lock()
+			rootResults[root] = last
+			rootResultsMu.Unlock()
+		}()
+	}
+
+	var globalResult []FileDiskUsage
+	collectWG.Add(1)
+	go func() {
+		defer collectWG.Done()
+		globalResult = collectGroup(global, limit, live)
+	}()
+
+	collectWG.Wait()
+
+	// Whatever --live drew to the terminal while the walk was still running
+	// is progress output, not the final report: the settled, scrollback-
+	// friendly result always lists every per-root table before the merged
+	// one, and the merged table always has rows under it, live or not.
+	if groupBy == groupByRoot {
+		for _, root := range roots {
+			fmt.Fprintf(tw, "== %s ==\n", root)
+			printTable(tw, rootResults[root])
+		}
+
+		fmt.Fprintln(tw, "== merged ==")
+	}
+
+	printTable(tw, globalResult)
+
+	return topG.Wait()
+}
+
+// collectGroup runs the heap collector over in to completion and returns
+// its final top-N. When renderLive is set, every throttled snapshot along
+// the way is also drawn in place via a ttyRenderer.
+func collectGroup(in <-chan FileDiskUsage, limit int, renderLive bool) []FileDiskUsage {
+	var renderer Renderer
+	if renderLive {
+		renderer = newTTYRenderer(os.Stdout)
+	}
+
+	snapshots := make(chan Snapshot)
+	ticker := time.NewTicker(liveRefreshInterval)
+
+	go func() {
+		defer close(snapshots)
+		defer ticker.Stop()
+		collectLastN(in, snapshots, limit, ticker.C, time.Now())
+	}()
+
+	var last []FileDiskUsage
+	for snap := range snapshots {
+		last = snap.Top
+		if renderer != nil {
+			renderer.Update(snap.Top, snap.Stats)
+		}
+	}
+
+	if renderer != nil {
+		renderer.Finalize()
+	}
+
+	return last
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	flag "github.com/spf13/pflag"
+)
+
+// errSymlinkCycle is returned by a --follow-symlinks StatFile when an entry
+// resolves to a directory already reached earlier in this walk, whether
+// through a symlink, its real path, or as the walk root. Callers treat it as a skip, not a fatal error: the walker's
+// errgroup would otherwise cancel the entire scan over a single cyclic
+// link.
+var errSymlinkCycle = errors.New("gofseek: symlink already visited, likely a cycle")
+
+const (
+	excludeFlag        = "exclude"
+	excludeFromFlag    = "exclude-from"
+	oneFilesystemFlag  = "one-filesystem"
+	minSizeFlag        = "min-size"
+	followSymlinksFlag = "follow-symlinks"
+)
+
+// SelectDir decides whether a directory should be traversed further.
+// Returning false prunes the entire subtree cheaply, before any of its
+// entries are read.
+type SelectDir func(path string, info os.FileInfo) bool
+
+// SelectFile decides whether a file should be reported to the caller.
+type SelectFile func(path string, info os.FileInfo) bool
+
+// Filters bundles the hooks a walk applies to every entry it visits.
+// Library users importing this package can build their own Filters (e.g.
+// to skip .git or node_modules) without forking the walker.
+type Filters struct {
+	SelectDir  SelectDir
+	SelectFile SelectFile
+
+	// StatFile resolves a directory entry's os.FileInfo. It's os.Lstat by
+	// default so symlinks are reported as themselves rather than walked;
+	// --follow-symlinks swaps it for followSymlinkStat, which resolves
+	// symlinks like os.Stat and returns errSymlinkCycle for a directory
+	// already reached.
+	StatFile func(path string) (os.FileInfo, error)
+}
+
+func defaultFilters() Filters {
+	return Filters{
+		SelectDir:  func(string, os.FileInfo) bool { return true },
+		SelectFile: func(string, os.FileInfo) bool { return true },
+		StatFile:   os.Lstat,
+	}
+}
+
+// addFilterFlags registers the --exclude, --exclude-from, --one-filesystem,
+// --min-size and --follow-symlinks flags shared by every subcommand that
+// walks the filesystem.
+func addFilterFlags(flagset *flag.FlagSet) {
+	flagset.StringArray(excludeFlag, nil, "Excludes paths matching this glob (repeatable), matched against each entry's absolute path")
+	flagset.String(excludeFromFlag, "", "Reads gitignore-style exclude globs from FILE, one per line")
+	flagset.Bool(oneFilesystemFlag, false, "Stays on the filesystem of the root path, skipping mount points")
+	flagset.Int64(minSizeFlag, 0, "Skips files smaller than this many bytes")
+	flagset.Bool(followSymlinksFlag, false, "Follows symlinks instead of reporting them as themselves")
+}
+
+// filtersFromFlags builds the Filters a CLI invocation asked for via the
+// flags addFilterFlags registers, relative to the given walk root.
+func filtersFromFlags(flagset *flag.FlagSet, root string) (Filters, error) {
+	excludes, err := flagset.GetStringArray(excludeFlag)
+	if err != nil {
+		return Filters{}, err
+	}
+
+	excludeFrom, err := flagset.GetString(excludeFromFlag)
+	if err != nil {
+		return Filters{}, err
+	}
+
+	oneFilesystem, err := flagset.GetBool(oneFilesystemFlag)
+	if err != nil {
+		return Filters{}, err
+	}
+
+	minSize, err := flagset.GetInt64(minSizeFlag)
+	if err != nil {
+		return Filters{}, err
+	}
+
+	followSymlinks, err := flagset.GetBool(followSymlinksFlag)
+	if err != nil {
+		return Filters{}, err
+	}
+
+	return buildFilters(root, excludes, excludeFrom, oneFilesystem, minSize, followSymlinks)
+}
+
+func buildFilters(root string, excludes []string, excludeFrom string, oneFilesystem bool, minSize int64, followSymlinks bool) (Filters, error) {
+	patterns := append([]string{}, excludes...)
+
+	if excludeFrom != "" {
+		fromFile, err := readPatternsFile(excludeFrom)
+		if err != nil {
+			return Filters{}, err
+		}
+		patterns = append(patterns, fromFile...)
+	}
+
+	var rootDev uint64
+	if oneFilesystem {
+		info, err := os.Stat(root)
+		if err != nil {
+			return Filters{}, err
+		}
+		rootDev = deviceOf(info)
+	}
+
+	selectDir := func(path string, info os.FileInfo) bool {
+		if matchesAny(patterns, path) {
+			return false
+		}
+		if oneFilesystem && deviceOf(info) != rootDev {
+			return false
+		}
+		return true
+	}
+
+	selectFile := func(path string, info os.FileInfo) bool {
+		if matchesAny(patterns, path) {
+			return false
+		}
+		if minSize > 0 && info.Size() < minSize {
+			return false
+		}
+		return true
+	}
+
+	statFile := os.Lstat
+	if followSymlinks {
+		guard := newSymlinkGuard()
+
+		// The walk root itself is opened directly and never passed through
+		// StatFile, so without this it would be the one directory a cyclic
+		// symlink could point back to without the guard ever noticing.
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			return Filters{}, err
+		}
+		guard.seen(deviceOf(rootInfo), inodeOf(rootInfo))
+
+		statFile = followSymlinkStat(guard)
+	}
+
+	return Filters{SelectDir: selectDir, SelectFile: selectFile, StatFile: statFile}, nil
+}
+
+// followSymlinkStat wraps os.Stat so every directory the walk reaches,
+// symlink or not, claims its (device, inode) in guard on first sighting;
+// whichever path gets there second — another symlink, or the directory's
+// own real path reached through a different parent — returns
+// errSymlinkCycle instead of being recursed into. The claim can't be
+// scoped to symlinks only: readdir order isn't guaranteed to visit a
+// directory's real entry before a symlink aliasing it (and the walk
+// fans recursion out concurrently via g.Go, so there's no ordering
+// guarantee across directories either), so whichever of the two wins
+// the race must block the other from also descending into the same
+// subtree and double-counting its files.
+func followSymlinkStat(guard *symlinkGuard) func(string) (os.FileInfo, error) {
+	return func(path string) (os.FileInfo, error) {
+		lst, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		isSymlink := lst.Mode()&os.ModeSymlink != 0
+		info := lst
+		if isSymlink {
+			info, err = os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !info.IsDir() {
+			return info, nil
+		}
+
+		if guard.seen(deviceOf(info), inodeOf(info)) {
+			return nil, errSymlinkCycle
+		}
+
+		return info, nil
+	}
+}
+
+// symlinkGuard deduplicates the (device, inode) pairs of every directory a
+// --follow-symlinks walk has already reached, symlink or not, so a link back to an
+// ancestor (or to a sibling already visited through another link) is
+// recognized and skipped instead of recursed into without bound.
+type symlinkGuard struct {
+	mu      sync.Mutex
+	visited map[[2]uint64]bool
+}
+
+func newSymlinkGuard() *symlinkGuard {
+	return &symlinkGuard{visited: make(map[[2]uint64]bool)}
+}
+
+func (g *symlinkGuard) seen(dev, ino uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := [2]uint64{dev, ino}
+	if g.visited[key] {
+		return true
+	}
+	g.visited[key] = true
+	return false
+}
+
+func matchesAny(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p, filepath.Base(path)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readPatternsFile reads --exclude-from patterns, one per line, using the
+// same conventions as .gitignore: blank lines and lines starting with `#`
+// are skipped.
+func readPatternsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, scanner.Err()
+}
+
+func deviceOf(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+
+	return 0
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// fileHeap is a min-heap of FileDiskUsage ordered by Size, so the smallest
+// of the current top-N sits at the root and gives an O(1) admission test
+// for incoming files.
+type fileHeap []FileDiskUsage
+
+func (h fileHeap) Len() int            { return len(h) }
+func (h fileHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) { *h = append(*h, x.(FileDiskUsage)) }
+
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// collectLastN keeps a size-n min-heap of the largest files seen on files,
+// admitting each new arrival in O(log n) only when it beats the current
+// smallest of the top-N (or the heap isn't full yet), which is why most
+// files in a large tree are rejected in O(1) by the root comparison alone.
+// A Snapshot is only forwarded to nextOut when the heap actually changed
+// and tick has fired since the last one, or files has closed, so live
+// rendering is decoupled from the rate files arrive at.
+func collectLastN(files <-chan FileDiskUsage, nextOut chan<- Snapshot, n int, tick <-chan time.Time, start time.Time) {
+	h := &fileHeap{}
+	heap.Init(h)
+	changed := false
+
+	var filesScanned, bytesScanned int64
+	var currentPath string
+
+	flush := func() {
+		if !changed {
+			return
+		}
+		nextOut <- Snapshot{
+			Top: sortedSnapshot(h),
+			Stats: Stats{
+				FilesScanned: filesScanned,
+				BytesScanned: bytesScanned,
+				Elapsed:      time.Since(start),
+				CurrentPath:  currentPath,
+			},
+		}
+		changed = false
+	}
+
+	for {
+		select {
+		case file, ok := <-files:
+			if !ok {
+				flush()
+				return
+			}
+
+			filesScanned++
+			bytesScanned += file.Size
+			currentPath = file.Path
+
+			switch {
+			case h.Len() < n:
+				heap.Push(h, file)
+				changed = true
+			case n > 0 && file.Size > (*h)[0].Size:
+				(*h)[0] = file
+				heap.Fix(h, 0)
+				changed = true
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
+
+// sortedSnapshot copies h's contents into a Size-descending slice, leaving
+// the heap itself untouched so collection can keep admitting files.
+func sortedSnapshot(h *fileHeap) []FileDiskUsage {
+	snapshot := make([]FileDiskUsage, len(*h))
+	copy(snapshot, *h)
+	sortBySizeDesc(snapshot)
+
+	return snapshot
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func runCollectLastN(t *testing.T, files []FileDiskUsage, n int) []FileDiskUsage {
+	t.Helper()
+
+	in := make(chan FileDiskUsage, len(files))
+	for _, f := range files {
+		in <- f
+	}
+	close(in)
+
+	out := make(chan Snapshot, len(files)+1)
+	collectLastN(in, out, n, make(chan time.Time), time.Now())
+	close(out)
+
+	var last Snapshot
+	for snap := range out {
+		last = snap
+	}
+
+	return last.Top
+}
+
+func TestCollectLastNTopN(t *testing.T) {
+	got := runCollectLastN(t, []FileDiskUsage{
+		{Path: "a", Size: 5},
+		{Path: "b", Size: 20},
+		{Path: "c", Size: 1},
+		{Path: "d", Size: 15},
+	}, 2)
+
+	want := []FileDiskUsage{{Path: "b", Size: 20}, {Path: "d", Size: 15}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCollectLastNZeroLimitNeverFlushes(t *testing.T) {
+	got := runCollectLastN(t, []FileDiskUsage{{Path: "a", Size: 100}}, 0)
+	if got != nil {
+		t.Fatalf("got %+v, want no snapshot for n == 0", got)
+	}
+}
+
+func TestCollectLastNFewerFilesThanLimit(t *testing.T) {
+	got := runCollectLastN(t, []FileDiskUsage{{Path: "a", Size: 1}, {Path: "b", Size: 2}}, 5)
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(got), got)
+	}
+	if got[0].Path != "b" || got[1].Path != "a" {
+		t.Errorf("got %+v, want [b a] descending by size", got)
+	}
+}
+
+func TestCollectLastNTies(t *testing.T) {
+	got := runCollectLastN(t, []FileDiskUsage{
+		{Path: "a", Size: 10},
+		{Path: "b", Size: 10},
+		{Path: "c", Size: 10},
+	}, 2)
+
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(got), got)
+	}
+	for _, f := range got {
+		if f.Size != 10 {
+			t.Errorf("unexpected size %d in %+v", f.Size, got)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IndexEntry is a single file record persisted in the on-disk index.
+type IndexEntry struct {
+	Path  string
+	Size  int64
+	Mtime time.Time
+	Inode uint64
+}
+
+// DirGroup is the unit of storage in the index file: every file discovered
+// directly under Dir, plus the directory's own mtime at scan time so a
+// later `gofseek update` can tell whether the group is stale without
+// re-reading its entries.
+type DirGroup struct {
+	Dir     string
+	Mtime   time.Time
+	Entries []IndexEntry
+}
+
+// defaultIndexPath returns ~/.cache/gofseek/index, the default location
+// `gofseek index`/`query`/`update` read and write when `--index` is unset.
+func defaultIndexPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".cache", "gofseek", "index"), nil
+}
+
+// writeIndex streams groups to w as a sequence of length-prefixed records,
+// one per directory, so `gofseek query` can decode the file incrementally
+// instead of loading a multi-GiB index into memory up front.
+func writeIndex(w io.Writer, groups <-chan DirGroup) error {
+	bw := bufio.NewWriter(w)
+
+	for group := range groups {
+		if err := writeDirGroup(bw, group); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeDirGroup(w *bufio.Writer, group DirGroup) error {
+	if err := writeString(w, group.Dir); err != nil {
+		return err
+	}
+	if err := writeVarint(w, group.Mtime.UnixNano()); err != nil {
+		return err
+	}
+	if err := writeUvarint(w, uint64(len(group.Entries))); err != nil {
+		return err
+	}
+
+	for _, e := range group.Entries {
+		if err := writeString(w, e.Path); err != nil {
+			return err
+		}
+		if err := writeVarint(w, e.Size); err != nil {
+			return err
+		}
+		if err := writeVarint(w, e.Mtime.UnixNano()); err != nil {
+			return err
+		}
+		if err := writeUvarint(w, e.Inode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeString(w *bufio.Writer, s string) error {
+	if err := writeUvarint(w, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := w.WriteString(s)
+	return err
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+func writeVarint(w *bufio.Writer, v int64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+// readIndex streams the index file at path, invoking fn once per directory
+// group so callers never hold more than one directory's worth of entries in
+// memory at a time.
+func readIndex(path string, fn func(DirGroup) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		group, err := readDirGroup(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(group); err != nil {
+			return err
+		}
+	}
+}
+
+func readDirGroup(r *bufio.Reader) (DirGroup, error) {
+	dir, err := readString(r)
+	if err != nil {
+		return DirGroup{}, err
+	}
+
+	mtimeNano, err := binary.ReadVarint(r)
+	if err != nil {
+		return DirGroup{}, err
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return DirGroup{}, err
+	}
+
+	group := DirGroup{
+		Dir:     dir,
+		Mtime:   time.Unix(0, mtimeNano),
+		Entries: make([]IndexEntry, 0, count),
+	}
+
+	for i := uint64(0); i < count; i++ {
+		path, err := readString(r)
+		if err != nil {
+			return DirGroup{}, err
+		}
+
+		size, err := binary.ReadVarint(r)
+		if err != nil {
+			return DirGroup{}, err
+		}
+
+		entMtime, err := binary.ReadVarint(r)
+		if err != nil {
+			return DirGroup{}, err
+		}
+
+		inode, err := binary.ReadUvarint(r)
+		if err != nil {
+			return DirGroup{}, err
+		}
+
+		group.Entries = append(group.Entries, IndexEntry{
+			Path:  path,
+			Size:  size,
+			Mtime: time.Unix(0, entMtime),
+			Inode: inode,
+		})
+	}
+
+	return group, nil
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
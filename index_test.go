@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeGroupsToTemp(t *testing.T, groups []DirGroup) string {
+	t.Helper()
+
+	in := make(chan DirGroup, len(groups))
+	for _, g := range groups {
+		in <- g
+	}
+	close(in)
+
+	var buf bytes.Buffer
+	if err := writeIndex(&buf, in); err != nil {
+		t.Fatalf("writeIndex: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	return path
+}
+
+func TestWriteReadIndexRoundTrip(t *testing.T) {
+	groups := []DirGroup{
+		{
+			Dir:   "/tmp/a",
+			Mtime: time.Unix(1000, 0),
+			Entries: []IndexEntry{
+				{Path: "/tmp/a/f1", Size: 123, Mtime: time.Unix(2000, 0), Inode: 42},
+				{Path: "/tmp/a/f2", Size: 0, Mtime: time.Unix(3000, 0), Inode: 43},
+			},
+		},
+		{Dir: "/tmp/b", Mtime: time.Unix(4000, 0)},
+	}
+
+	path := writeGroupsToTemp(t, groups)
+
+	var got []DirGroup
+	if err := readIndex(path, func(g DirGroup) error {
+		got = append(got, g)
+		return nil
+	}); err != nil {
+		t.Fatalf("readIndex: %v", err)
+	}
+
+	if len(got) != len(groups) {
+		t.Fatalf("got %d groups, want %d", len(got), len(groups))
+	}
+	for i, g := range got {
+		want := groups[i]
+		if g.Dir != want.Dir || !g.Mtime.Equal(want.Mtime) || len(g.Entries) != len(want.Entries) {
+			t.Fatalf("group[%d] = %+v, want %+v", i, g, want)
+		}
+		for j, e := range g.Entries {
+			wantEntry := want.Entries[j]
+			if e.Path != wantEntry.Path || e.Size != wantEntry.Size || !e.Mtime.Equal(wantEntry.Mtime) || e.Inode != wantEntry.Inode {
+				t.Errorf("group[%d].Entries[%d] = %+v, want %+v", i, j, e, wantEntry)
+			}
+		}
+	}
+}
+
+func TestReadIndexTruncatedRecord(t *testing.T) {
+	path := writeGroupsToTemp(t, []DirGroup{
+		{
+			Dir:   "/tmp/a",
+			Mtime: time.Unix(1000, 0),
+			Entries: []IndexEntry{
+				{Path: "/tmp/a/" + strings.Repeat("f", 64), Size: 1, Mtime: time.Unix(1, 0), Inode: 1},
+			},
+		},
+	})
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	// Cut well inside the entry's path string, not at a record boundary,
+	// so the failure is a genuine truncation rather than a clean stop.
+	truncated := raw[:len(raw)-10]
+	if err := os.WriteFile(path, truncated, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err = readIndex(path, func(DirGroup) error { return nil })
+	if err == nil {
+		t.Fatal("expected an error reading a truncated index, got nil")
+	}
+	if err == io.EOF {
+		t.Fatal("a mid-record truncation must not be reported as a clean end of file")
+	}
+}
+
+func TestReadIndexMissingFile(t *testing.T) {
+	err := readIndex(filepath.Join(t.TempDir(), "missing"), func(DirGroup) error { return nil })
+	if !os.IsNotExist(err) {
+		t.Fatalf("got %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// indexWalk walks path via walkTree, the same traversal walkDir uses, but
+// aggregates path's own files into a single DirGroup instead of emitting
+// one FileDiskUsage per file, so the caller can persist the tree to the
+// on-disk index grouped the way it's stored.
+func indexWalk(ctx context.Context, g *errgroup.Group, sem *semaphore.Weighted, path string, filters Filters, groups chan<- DirGroup) error {
+	dirInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	group := DirGroup{Dir: path, Mtime: dirInfo.ModTime()}
+
+	visitFile := func(filePath string, info os.FileInfo) error {
+		group.Entries = append(group.Entries, IndexEntry{
+			Path:  filePath,
+			Size:  info.Size(),
+			Mtime: info.ModTime(),
+			Inode: inodeOf(info),
+		})
+		return nil
+	}
+
+	recurseDir := func(childPath string) error {
+		return indexWalk(ctx, g, sem, childPath, filters, groups)
+	}
+
+	if err := walkTree(ctx, g, sem, path, filters, visitFile, recurseDir); err != nil {
+		return err
+	}
+
+	select {
+	case groups <- group:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+
+	return 0
+}
+
+// dirMtimes reads the existing index at path and returns the recorded mtime
+// for every directory it covers, so `gofseek update` can tell which
+// subtrees changed since the last scan without re-walking any of them.
+func dirMtimes(path string) (map[string]time.Time, error) {
+	mtimes := make(map[string]time.Time)
+
+	err := readIndex(path, func(group DirGroup) error {
+		mtimes[group.Dir] = group.Mtime
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return mtimes, nil
+	}
+
+	return mtimes, err
+}
@@ -1,23 +1,33 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"sort"
-	"sync"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
-	pathFlag  = "path"
-	limitFlag = "limit"
-	liveFlag  = "live"
+	pathFlag        = "path"
+	limitFlag       = "limit"
+	liveFlag        = "live"
+	noConsoleFlag   = "no-console"
+	concurrencyFlag = "concurrency"
+
+	// liveRefreshInterval throttles how often --live redraws the top-N
+	// table, decoupling rendering from the rate files arrive at.
+	liveRefreshInterval = 100 * time.Millisecond
 )
 
 var tw *tabwriter.Writer
@@ -45,153 +55,88 @@ type FileDiskUsage struct {
 
 func initFlags(cmd string, args []string) *flag.FlagSet {
 	flagset := flag.NewFlagSet(cmd, flag.ExitOnError)
-	flagset.StringP(pathFlag, "p", "", "Defines the target path to search for files and their disk usage")
+	flagset.StringArrayP(pathFlag, "p", nil, "Defines a target root to search for files and their disk usage (repeatable); positional args are additional roots")
 	flagset.IntP(limitFlag, "l", 100, "Defines the limit of top biggest files to print out")
-	flagset.Bool(liveFlag, false, "Enable live output")
+	flagset.Bool(liveFlag, isTerminalDefault(), "Redraws the top-N table in place instead of printing it once at the end")
+	flagset.Bool(noConsoleFlag, false, "Forces plain-line output even when stdout is a terminal")
+	flagset.Int64(concurrencyFlag, defaultConcurrency(), "Defines the number of directories that may be read concurrently")
+	flagset.String(groupByFlag, groupByRoot, `Defines how multi-root results are grouped: "root" (default, a table per root plus a merged table) or "none" (a single global table)`)
+	addFilterFlags(flagset)
 	flagset.Parse(args)
 
 	return flagset
 }
 
-func main() {
-	flags := initFlags(os.Args[0], os.Args[1:])
-
-	path, err := flags.GetString(pathFlag)
-	if err != nil {
-		log.Fatal(err)
+// defaultConcurrency picks a sane default for the directory-read semaphore:
+// the number of usable CPUs, capped so the walker never claims more than
+// half of the process' open file descriptor budget.
+func defaultConcurrency() int64 {
+	n := int64(runtime.GOMAXPROCS(0))
+
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err == nil {
+		// An unlimited budget (RLIM_INFINITY) converts to a negative int64
+		// and leaves n uncapped.
+		if cur := int64(rlimit.Cur); cur >= 0 && cur/2 < n {
+			n = cur / 2
+		}
 	}
 
-	if path == "" {
-		log.Fatalf("argument `--%s` to seek biggest files required", pathFlag)
+	if n < 1 {
+		n = 1
 	}
 
-	limit, err := flags.GetInt(limitFlag)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return n
+}
 
-	live, err := flags.GetBool(liveFlag)
-	if err != nil {
+func main() {
+	if err := run(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
-
-	log.Printf("Seeking top %d biggest files in path '%s'", limit, path)
-
-	diskUsage := make(chan FileDiskUsage)
-	wg := new(sync.WaitGroup)
-	wg.Add(1)
-
-	go func() {
-		log.Printf("Starting with path: %s", path)
-		if err := walkDir(path, wg, diskUsage); err != nil {
-			log.Printf("Error processing path %s: %v", path, err)
-		}
-	}()
-
-	go func() {
-		wg.Wait()
-		close(diskUsage)
-	}()
-
-	lastDiskUsage := make(chan []FileDiskUsage)
-	go func() {
-		collectLastN(diskUsage, lastDiskUsage, limit)
-	}()
-
-	drained := make(chan struct{}, 1)
-	ticker := time.NewTicker(10 * time.Millisecond)
-
-	go func() {
-		var last []FileDiskUsage
-		for cs := range lastDiskUsage {
-			select {
-			case <-ticker.C:
-				if live {
-					last = cs
-					tw.Flush()
-					printLastN(tw, last)
-				}
-			default:
-				last = cs
-			}
-		}
-
-		ticker.Stop()
-		tw.Flush()
-		printLastN(tw, last)
-		drained <- struct{}{}
-	}()
-
-	<-drained
-	close(drained)
-	close(lastDiskUsage)
 }
 
-func walkDir(path string, wg *sync.WaitGroup, diskUsage chan<- FileDiskUsage) error {
-	defer wg.Done()
-
-	log.Debugf("Processing path %s\n", path)
-
-	file, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-
-	dirents, err := file.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range dirents {
-		filePath := fmt.Sprintf("%s/%s", path, entry)
-		fileinfo, err := os.Stat(filePath)
-		if err != nil {
-			return err
-		}
-
-		if fileinfo.IsDir() {
-			wg.Add(1)
-			go func(subDir string, wg *sync.WaitGroup, fc chan<- FileDiskUsage) {
-				walkDir(subDir, wg, fc)
-			}(filePath, wg, diskUsage)
-		} else {
-			diskUsage <- FileDiskUsage{
-				Path: filePath,
-				Size: fileinfo.Size(),
-			}
+// run dispatches to the index/query/update subcommands, falling back to the
+// direct scan (runScan) when args don't start with one of them, so an
+// invocation without a subcommand still scans the given roots.
+func run(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "index":
+			return runIndexCmd(args[1:])
+		case "query":
+			return runQueryCmd(args[1:])
+		case "update":
+			return runUpdateCmd(args[1:])
 		}
-
 	}
 
-	return nil
+	return runScan(args)
 }
 
-func collectLastN(files <-chan FileDiskUsage, nextOut chan<- []FileDiskUsage, n int) {
-	cap := n + 1
-	buf := make([]FileDiskUsage, cap)
-
-	for file := range files {
-		buf = append(buf, file)
-
-		if len(buf) < cap {
-			continue
+// walkDir walks path via walkTree, forwarding every file it visits to
+// diskUsage.
+func walkDir(ctx context.Context, g *errgroup.Group, sem *semaphore.Weighted, path string, filters Filters, diskUsage chan<- FileDiskUsage) error {
+	visitFile := func(filePath string, info os.FileInfo) error {
+		select {
+		case diskUsage <- FileDiskUsage{Path: filePath, Size: info.Size()}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
 
-		sort.Slice(buf, func(i, j int) bool {
-			return buf[i].Size > buf[j].Size
-		})
-
-		buf = buf[0:n]
-		nextOut <- buf
+	var recurseDir func(string) error
+	recurseDir = func(childPath string) error {
+		return walkTree(ctx, g, sem, childPath, filters, visitFile, recurseDir)
 	}
 
-	if len(buf) <= n {
-		sort.Slice(buf, func(i, j int) bool {
-			return buf[i].Size > buf[j].Size
-		})
+	return walkTree(ctx, g, sem, path, filters, visitFile, recurseDir)
+}
 
-		nextOut <- buf
-	}
+func sortBySizeDesc(files []FileDiskUsage) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
 }
 
 func printLastN(writer io.Writer, usages []FileDiskUsage) {
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Stats summarizes a scan's progress for a Renderer.
+type Stats struct {
+	FilesScanned int64
+	BytesScanned int64
+	Elapsed      time.Duration
+	CurrentPath  string
+}
+
+// Snapshot pairs a top-N table with the Stats as of when it was produced.
+type Snapshot struct {
+	Top   []FileDiskUsage
+	Stats Stats
+}
+
+// Renderer is the live-rendering backend for a scan. Update is called once
+// per throttled snapshot; Finalize once the walk has completed, so the
+// renderer can draw (or re-draw, for the last time) its final state.
+type Renderer interface {
+	Update(top []FileDiskUsage, stats Stats)
+	Finalize()
+}
+
+// isTerminalDefault reports whether stdout is a terminal, used as --live's
+// default so piping gofseek's output never produces garbled repeated lines.
+func isTerminalDefault() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// ttyRenderer redraws the top-N table in place using ANSI cursor-up and
+// erase-to-end-of-screen escapes, preceded by a header line with scan
+// progress.
+type ttyRenderer struct {
+	out       io.Writer
+	lastLines int
+}
+
+func newTTYRenderer(out io.Writer) *ttyRenderer {
+	return &ttyRenderer{out: out}
+}
+
+func (r *ttyRenderer) Update(top []FileDiskUsage, stats Stats) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Scanned %d files, %d bytes, in %s — %s\n",
+		stats.FilesScanned, stats.BytesScanned, stats.Elapsed.Round(time.Millisecond), stats.CurrentPath)
+
+	tw := tabwriter.NewWriter(&buf, 5, 0, 1, ' ', 0)
+	printLastN(tw, top)
+	tw.Flush()
+
+	r.redraw(buf.String())
+}
+
+func (r *ttyRenderer) redraw(content string) {
+	if r.lastLines > 0 {
+		fmt.Fprintf(r.out, "\033[%dA\033[J", r.lastLines)
+	}
+
+	fmt.Fprint(r.out, content)
+	r.lastLines = strings.Count(content, "\n")
+}
+
+func (r *ttyRenderer) Finalize() {
+	fmt.Fprintln(r.out)
+}
+
+// plainRenderer ignores intermediate updates and emits the final table once
+// via text/tabwriter, so a non-TTY destination (pipe, CI log) gets a single
+// clean table instead of a stream of redraws.
+type plainRenderer struct {
+	out  *tabwriter.Writer
+	last []FileDiskUsage
+}
+
+func newPlainRenderer(out *tabwriter.Writer) *plainRenderer {
+	return &plainRenderer{out: out}
+}
+
+func (r *plainRenderer) Update(top []FileDiskUsage, stats Stats) {
+	r.last = top
+}
+
+func (r *plainRenderer) Finalize() {
+	printLastN(r.out, r.last)
+	r.out.Flush()
+}
+
+// printTable drives a plainRenderer over a single already-final result set,
+// so the one-shot tables runScan prints (per-root and merged) go through
+// the same Renderer the live path uses instead of calling printLastN
+// directly.
+func printTable(w *tabwriter.Writer, results []FileDiskUsage) {
+	r := newPlainRenderer(w)
+	r.Update(results, Stats{})
+	r.Finalize()
+}
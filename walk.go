@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// walkTree is the traversal primitive shared by the plain scan, index
+// build, and incremental update: it reads dir's entries once, applies
+// filters, invokes visitFile for each qualifying file, and fans each
+// qualifying subdirectory out onto g via recurseDir, one g.Go call each.
+// Reads of dir are gated by sem so a tree with many subdirectories can't
+// open more file descriptors at once than the process can afford; the
+// permit is acquired before os.Open and released as soon as Readdirnames
+// returns, well before visitFile or recurseDir run. Callers differ only in
+// what visitFile does with a file and what recurseDir does for a
+// subdirectory (walk further with the same logic, or something else
+// entirely, as the incremental updater does for unchanged directories).
+func walkTree(ctx context.Context, g *errgroup.Group, sem *semaphore.Weighted, dir string, filters Filters, visitFile func(path string, info os.FileInfo) error, recurseDir func(path string) error) error {
+	log.Debugf("Walking path %s\n", dir)
+
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		sem.Release(1)
+		return err
+	}
+
+	dirents, err := file.Readdirnames(-1)
+	file.Close()
+	sem.Release(1)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range dirents {
+		entryPath := filepath.Join(dir, entry)
+
+		fileinfo, err := filters.StatFile(entryPath)
+		if errors.Is(err, errSymlinkCycle) {
+			log.Warnf("Skipping %s: %v", entryPath, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if fileinfo.IsDir() {
+			if !filters.SelectDir(entryPath, fileinfo) {
+				continue
+			}
+			childPath := entryPath
+			g.Go(func() error {
+				return recurseDir(childPath)
+			})
+			continue
+		}
+
+		if !filters.SelectFile(entryPath, fileinfo) {
+			continue
+		}
+
+		if err := visitFile(entryPath, fileinfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}